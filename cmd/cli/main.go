@@ -0,0 +1,198 @@
+// Command cli runs the unmht pipeline locally, for development and
+// debugging without a Lambda deploy. With no subcommand it reads a raw
+// .eml (or the .mht it wraps) from stdin or a file argument, prints the
+// analytics, and writes the extracted PNG to disk. `cli query` instead
+// dumps a user's stored history so it can be graphed externally.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/mail"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	unmhtmail "github.com/fmovlex/unmht-aws/mail"
+	"github.com/fmovlex/unmht-aws/store"
+	"github.com/fmovlex/unmht-aws/vision"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		if err := queryCmd(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	offline := flag.Bool("offline", false, "skip OCR/analytics entirely - no AWS calls, just extract the PNG")
+	out := flag.String("out", "times.png", "path to write the extracted PNG to")
+	flag.Parse()
+
+	var in io.Reader = os.Stdin
+	if path := flag.Arg(0); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("failed to open %s: %v", path, err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	if err := run(in, *out, *offline); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(in io.Reader, out string, offline bool) error {
+	msg, err := mail.ReadMessage(in)
+	if err != nil {
+		return fmt.Errorf("failed to read mail message: %v", err)
+	}
+
+	mht64, err := unmhtmail.ExtractMHT(msg)
+	if err != nil {
+		return fmt.Errorf("failed to extract mht: %v", err)
+	}
+	mht := base64.NewDecoder(base64.StdEncoding, mht64)
+
+	mhtMsg, err := mail.ReadMessage(mht)
+	if err != nil {
+		return fmt.Errorf("failed to read mail message inside mht: %v", err)
+	}
+
+	png64, err := unmhtmail.ExtractPNG(mhtMsg)
+	if err != nil {
+		return fmt.Errorf("failed to extract png: %v", err)
+	}
+
+	pngb, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, png64))
+	if err != nil {
+		return fmt.Errorf("failed to decode png: %v", err)
+	}
+
+	if err := ioutil.WriteFile(out, pngb, 0644); err != nil {
+		return fmt.Errorf("failed to write png to %s: %v", out, err)
+	}
+	fmt.Printf("wrote %s\n", out)
+
+	if offline {
+		fmt.Println("offline: skipping analytics")
+		return nil
+	}
+
+	s, err := session.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create aws session: %v", err)
+	}
+
+	magic, _, err := vision.Analyze(s, "", "cli", bytes.NewReader(pngb))
+	if err != nil {
+		return fmt.Errorf("failed to analyze: %v", err)
+	}
+
+	analytics, err := vision.RenderAnalytics(magic)
+	if err != nil {
+		return fmt.Errorf("failed to render analytics: %v", err)
+	}
+
+	fmt.Println(analytics)
+	return nil
+}
+
+func queryCmd(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	user := fs.String("user", "", "user email to query (required)")
+	from := fs.String("from", "", "start date, YYYY-MM-DD (required)")
+	to := fs.String("to", "", "end date, YYYY-MM-DD (required)")
+	format := fs.String("format", "csv", "csv or json")
+	sqlitePath := fs.String("sqlite", "", "path to the sqlite store")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *user == "" || *from == "" || *to == "" || *sqlitePath == "" {
+		return fmt.Errorf("-user, -from, -to and -sqlite are all required")
+	}
+
+	fromT, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		return fmt.Errorf("failed to parse -from: %v", err)
+	}
+	toT, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		return fmt.Errorf("failed to parse -to: %v", err)
+	}
+
+	st, err := store.NewSQLiteStore(*sqlitePath)
+	if err != nil {
+		return err
+	}
+
+	entries, err := st.Query(*user, fromT, toT)
+	if err != nil {
+		return fmt.Errorf("failed to query history: %v", err)
+	}
+
+	switch *format {
+	case "json":
+		return writeJSON(os.Stdout, entries)
+	case "csv":
+		return writeCSV(os.Stdout, entries)
+	default:
+		return fmt.Errorf("unknown -format: %s (want csv or json)", *format)
+	}
+}
+
+type entryRow struct {
+	Date     string `json:"date"`
+	Activity string `json:"activity"`
+	In       string `json:"in,omitempty"`
+	Out      string `json:"out,omitempty"`
+}
+
+func toRow(e vision.Entry) entryRow {
+	row := entryRow{
+		Date:     e.Date().Format("2006-01-02"),
+		Activity: e.Activity(),
+	}
+	if in := e.In(); in != nil {
+		row.In = in.Format("15:04")
+	}
+	if out := e.Out(); out != nil {
+		row.Out = out.Format("15:04")
+	}
+	return row
+}
+
+func writeJSON(w io.Writer, entries []vision.Entry) error {
+	rows := make([]entryRow, len(entries))
+	for i, e := range entries {
+		rows[i] = toRow(e)
+	}
+	return json.NewEncoder(w).Encode(rows)
+}
+
+func writeCSV(w io.Writer, entries []vision.Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"date", "activity", "in", "out"}); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		row := toRow(e)
+		if err := cw.Write([]string{row.Date, row.Activity, row.In, row.Out}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,93 @@
+// Command httpd is a small HTTP daemon alternative to the Lambda
+// entrypoint: a mail relay (e.g. a Postfix pipe) POSTs a raw message to
+// /ingest and gets the rendered reply back in the response body, instead
+// of unmht sending it itself.
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/fmovlex/unmht-aws"
+)
+
+func main() {
+	cfg := unmht.ConfigFromEnv()
+
+	store, err := unmht.StoreFromEnv()
+	if err != nil {
+		log.Fatalf("failed to set up store: %v", err)
+	}
+	cfg.Store = store
+
+	addr := os.Getenv("UNMHT_HTTPD_ADDR")
+	if addr == "" {
+		addr = ":8080"
+	}
+
+	http.HandleFunc("/ingest", ingestHandler(cfg))
+
+	log.Printf("listening on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+// captureReplier hands the rendered reply back to the caller instead of
+// sending it itself - the httpd source has no transport of its own.
+type captureReplier struct {
+	rep string
+}
+
+func (c *captureReplier) Reply(rep string) error {
+	c.rep = rep
+	return nil
+}
+
+func ingestHandler(cfg unmht.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		from := r.URL.Query().Get("from")
+		to := r.URL.Query().Get("to")
+		msgID := r.URL.Query().Get("msgId")
+		if from == "" || to == "" || msgID == "" {
+			http.Error(w, "from, to and msgId query params are required", http.StatusBadRequest)
+			return
+		}
+
+		raw, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		s, err := session.NewSession()
+		if err != nil {
+			http.Error(w, "failed to create aws session", http.StatusInternalServerError)
+			return
+		}
+
+		in := unmht.IncomingMail{
+			From: from,
+			To:   []string{to},
+			Raw:  bytes.NewReader(raw),
+			ID:   msgID,
+		}
+
+		replier := &captureReplier{}
+		if err := unmht.Process(cfg, s, in, replier); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		w.Header().Set("Content-Type", "message/rfc822")
+		w.Write([]byte(replier.rep))
+	}
+}
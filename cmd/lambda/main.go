@@ -0,0 +1,68 @@
+// Command lambda is the AWS Lambda entrypoint: SES drops an incoming
+// message in S3 and invokes this function with a notification pointing at
+// it. It's a thin wrapper around unmht.Process - see cmd/cli for a local,
+// AWS-free way to run the same pipeline.
+package main
+
+import (
+	"log"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/fmovlex/unmht-aws"
+)
+
+var cfg unmht.Config
+
+func main() {
+	cfg = unmht.ConfigFromEnv()
+
+	store, err := unmht.StoreFromEnv()
+	if err != nil {
+		log.Fatalf("failed to set up store: %v", err)
+	}
+	cfg.Store = store
+
+	lambda.Start(handler)
+}
+
+type SESNotification struct {
+	Records []struct {
+		SES struct {
+			Mail struct {
+				Source      string   `json:"source"`
+				Destination []string `json:"destination"`
+				MessageID   string   `json:"messageId"`
+			} `json:"mail"`
+		} `json:"ses"`
+	} `json:"Records"`
+}
+
+func handler(in SESNotification) {
+	sesMail := in.Records[0].SES.Mail
+
+	s, err := session.NewSession()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	body, err := unmht.GetMail(s, cfg.Bucket, sesMail.MessageID)
+	if err != nil {
+		log.Printf("failed to get mail from s3: %v", err)
+		return
+	}
+	defer body.Close()
+
+	incoming := unmht.IncomingMail{
+		From: sesMail.Source,
+		To:   sesMail.Destination,
+		Raw:  body,
+		ID:   sesMail.MessageID,
+	}
+
+	if err := unmht.Process(cfg, s, incoming, unmht.SESReplier{Session: s}); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,61 @@
+// Package unmht wires the mail, vision and skeleton packages into the
+// shared processing core, plus the mail sources (SES/S3 and IMAP) that
+// feed it. The cmd/lambda, cmd/cli and cmd/httpd entrypoints are thin
+// wrappers around this package.
+package unmht
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/fmovlex/unmht-aws/store"
+)
+
+// Config is the whitelist/domain/storage configuration shared by every
+// source, loaded from env by every entry command.
+type Config struct {
+	Bucket    string
+	Domains   []string
+	Whitelist []string
+	// Store is optional: when nil, Process skips persistence and trends
+	// entirely.
+	Store store.Store
+}
+
+func ConfigFromEnv() Config {
+	return Config{
+		Bucket:    os.Getenv("UNMHT_BUCKET"),
+		Domains:   strings.Split(os.Getenv("UNMHT_EMAILS"), ","),
+		Whitelist: strings.Split(os.Getenv("UNMHT_SENDER_WHITELIST"), ","),
+	}
+}
+
+// StoreFromEnv builds the store.Store selected by UNMHT_STORE, or nil if
+// it's unset - persistence and trends are opt-in.
+func StoreFromEnv() (store.Store, error) {
+	switch os.Getenv("UNMHT_STORE") {
+	case "":
+		return nil, nil
+	case "dynamodb":
+		table := os.Getenv("UNMHT_STORE_TABLE")
+		if table == "" {
+			return nil, fmt.Errorf("UNMHT_STORE_TABLE is required for UNMHT_STORE=dynamodb")
+		}
+		s, err := session.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create aws session: %v", err)
+		}
+		return store.NewDynamoStore(s, table), nil
+	case "sqlite":
+		path := os.Getenv("UNMHT_STORE_SQLITE_PATH")
+		if path == "" {
+			return nil, fmt.Errorf("UNMHT_STORE_SQLITE_PATH is required for UNMHT_STORE=sqlite")
+		}
+		return store.NewSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("unknown UNMHT_STORE backend: %s", os.Getenv("UNMHT_STORE"))
+	}
+}
@@ -0,0 +1,188 @@
+package unmht
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	unmhtmail "github.com/fmovlex/unmht-aws/mail"
+	"github.com/fmovlex/unmht-aws/vision"
+)
+
+// IncomingMail is the transport-agnostic view of a message that a Source
+// has fetched: who it's from, which of our domains it was sent to, and the
+// raw MIME bytes. Everything past this point (whitelist check, MHT/PNG
+// extraction, analysis, reply) is the same regardless of where the mail
+// came from.
+type IncomingMail struct {
+	From string
+	To   []string
+	Raw  io.Reader
+	// ID is a transport-specific identifier used for debug uploads
+	// (S3 object key for SES, IMAP UID for the imap source, ...).
+	ID string
+}
+
+// Replier sends the rendered reply back to the sender. Sources provide
+// their own implementation (SES for the Lambda path, SMTP for imap).
+type Replier interface {
+	Reply(rep string) error
+}
+
+// Process runs the shared pipeline: whitelist check -> extractMHT ->
+// extractPNG -> analyze -> sendReply. It's the core every Source funnels
+// its incoming mail through.
+func Process(cfg Config, s *session.Session, in IncomingMail, replier Replier) error {
+	if err := cfg.checkWhitelist(in.From); err != nil {
+		return err
+	}
+
+	unmhtRecipient, err := cfg.findMe(in.To)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mail.ReadMessage(in.Raw)
+	if err != nil {
+		return fmt.Errorf("failed to read mail message: %v", err)
+	}
+
+	mht64, err := unmhtmail.ExtractMHT(msg)
+	if err != nil {
+		return fmt.Errorf("failed to extract mht: %v", err)
+	}
+
+	mht := base64.NewDecoder(base64.StdEncoding, mht64)
+
+	mhtMsg, err := mail.ReadMessage(mht)
+	if err != nil {
+		return fmt.Errorf("failed to read mail message inside mht: %v", err)
+	}
+
+	png64, err := unmhtmail.ExtractPNG(mhtMsg)
+	if err != nil {
+		return fmt.Errorf("failed to extract png: %v", err)
+	}
+	png64b, _ := ioutil.ReadAll(png64)
+
+	pngr := base64.NewDecoder(base64.StdEncoding, bytes.NewReader(png64b))
+	analytics, magic, entries := cfg.analyze(s, in.From, in.ID, pngr)
+
+	var fixes []string
+	if magic != nil {
+		fixes = magic.Fixes
+	}
+
+	rep, err := unmhtmail.RenderReply(unmhtmail.ReplyData{
+		From:      unmhtRecipient,
+		To:        in.From,
+		Subject:   msg.Header.Get("Subject"),
+		InReplyTo: msg.Header.Get("Message-ID"),
+		Analytics: analytics,
+		PNGStr:    string(png64b),
+		Entries:   unmhtmail.FormatEntries(entries),
+		Fixes:     fixes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render reply template: %v", err)
+	}
+
+	if err := replier.Reply(rep); err != nil {
+		return fmt.Errorf("failed to send reply: %v", err)
+	}
+
+	return nil
+}
+
+// analyze runs OCR, persists the week and folds in trends when a Store is
+// configured, and renders the result down to the text that goes in the
+// reply. It also returns the magic and parsed entries so Process can build
+// the HTML alternative's table and fixes block.
+func (cfg Config) analyze(s *session.Session, userEmail string, msgID string, pngr io.Reader) (string, *vision.Magic, []vision.Entry) {
+	const nothing = "no analytics available."
+
+	magic, entries, err := vision.Analyze(s, cfg.Bucket, msgID, pngr)
+	if err != nil {
+		log.Printf("failed to get analytics: %v\n", err)
+		return nothing, nil, nil
+	}
+
+	if cfg.Store != nil {
+		magic.Trends = cfg.recordAndTrend(userEmail, entries)
+	}
+
+	str, err := vision.RenderAnalytics(magic)
+	if err != nil {
+		log.Printf("failed to render analytics: %v\n", err)
+		return nothing, magic, entries
+	}
+
+	return str, magic, entries
+}
+
+// historyWindow is how far back PutWeek/Query compares when looking for a
+// user's baseline.
+const historyWindow = 12 * 7 * 24 * time.Hour
+
+func (cfg Config) recordAndTrend(userEmail string, entries []vision.Entry) *vision.TrendsReport {
+	weekStart := vision.WeekStart(entries)
+	if weekStart.IsZero() {
+		return nil
+	}
+
+	if err := cfg.Store.PutWeek(userEmail, weekStart, entries); err != nil {
+		log.Printf("failed to persist week: %v\n", err)
+	}
+
+	history, err := cfg.Store.Query(userEmail, weekStart.Add(-historyWindow), weekStart.AddDate(0, 0, -1))
+	if err != nil {
+		log.Printf("failed to query history: %v\n", err)
+		return nil
+	}
+
+	return vision.ComputeTrends(entries, history, 2.0)
+}
+
+func (cfg Config) checkWhitelist(source string) error {
+	whiteset := map[string]bool{}
+	for _, w := range cfg.Whitelist {
+		whiteset[w] = true
+	}
+
+	addr, err := mail.ParseAddress(source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source address: %v", err)
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	domain := addr.Address[at+1:]
+
+	if _, ok := whiteset[domain]; !ok {
+		return fmt.Errorf("sender not in whitelist: %v [%v]", source, domain)
+	}
+
+	return nil
+}
+
+func (cfg Config) findMe(dest []string) (string, error) {
+	domset := map[string]bool{}
+	for _, d := range cfg.Domains {
+		domset[d] = true
+	}
+
+	for _, d := range dest {
+		if _, ok := domset[d]; ok {
+			return d, nil
+		}
+	}
+
+	return "", fmt.Errorf("self-domain not found in destinations: %v", dest)
+}
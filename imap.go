@@ -0,0 +1,312 @@
+package unmht
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// IMAPConfig is the connection info for a self-hosted mailbox source. It's
+// intentionally small and JSON-tagged so it can be loaded either from
+// UNMHT_IMAP_* env vars or from a config file pointed at by
+// UNMHT_IMAP_CONFIG.
+type IMAPConfig struct {
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Mailbox  string `json:"mailbox"`
+	TLS      bool   `json:"tls"`
+	// SMTPServer/SMTPPort are the outbound submission endpoint. Most
+	// providers run IMAP and SMTP on different hosts (smtp.gmail.com vs
+	// imap.gmail.com), so these are configured separately from Server
+	// rather than derived from it. SMTPPort defaults to 587.
+	SMTPServer string `json:"smtpServer"`
+	SMTPPort   int    `json:"smtpPort"`
+	// SMTPTLS controls STARTTLS on the SMTP connection, independently of
+	// TLS (which is the IMAP side's implicit TLS).
+	SMTPTLS bool `json:"smtpTLS"`
+	// PollInterval controls how often the mailbox is checked when the
+	// server doesn't support IDLE. Defaults to 30s.
+	PollInterval time.Duration `json:"pollInterval"`
+}
+
+func LoadIMAPConfig() (IMAPConfig, error) {
+	if path := os.Getenv("UNMHT_IMAP_CONFIG"); path != "" {
+		return loadIMAPConfigFile(path)
+	}
+
+	poll := 30 * time.Second
+	if s := os.Getenv("UNMHT_IMAP_POLL_SECONDS"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return IMAPConfig{}, fmt.Errorf("failed to parse UNMHT_IMAP_POLL_SECONDS: %v", err)
+		}
+		poll = time.Duration(n) * time.Second
+	}
+
+	smtpPort := 587
+	if s := os.Getenv("UNMHT_SMTP_PORT"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return IMAPConfig{}, fmt.Errorf("failed to parse UNMHT_SMTP_PORT: %v", err)
+		}
+		smtpPort = n
+	}
+
+	cfg := IMAPConfig{
+		Server:       os.Getenv("UNMHT_IMAP_SERVER"),
+		Username:     os.Getenv("UNMHT_IMAP_USERNAME"),
+		Password:     os.Getenv("UNMHT_IMAP_PASSWORD"),
+		Mailbox:      os.Getenv("UNMHT_IMAP_MAILBOX"),
+		TLS:          os.Getenv("UNMHT_IMAP_TLS") != "false",
+		SMTPServer:   os.Getenv("UNMHT_SMTP_SERVER"),
+		SMTPPort:     smtpPort,
+		SMTPTLS:      os.Getenv("UNMHT_SMTP_TLS") != "false",
+		PollInterval: poll,
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+
+	if cfg.Server == "" || cfg.Username == "" {
+		return cfg, fmt.Errorf("UNMHT_IMAP_SERVER and UNMHT_IMAP_USERNAME are required")
+	}
+	if cfg.SMTPServer == "" {
+		return cfg, fmt.Errorf("UNMHT_SMTP_SERVER is required")
+	}
+
+	return cfg, nil
+}
+
+func loadIMAPConfigFile(path string) (IMAPConfig, error) {
+	// TLS and SMTPTLS default to true the same way the env-var path does;
+	// set them before Unmarshal so a config file that simply omits
+	// "tls"/"smtpTLS" doesn't silently fall back to the bool zero value
+	// and downgrade to plaintext.
+	cfg := IMAPConfig{TLS: true, SMTPTLS: true}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read imap config file: %v", err)
+	}
+
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse imap config file: %v", err)
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 30 * time.Second
+	}
+	if cfg.SMTPPort == 0 {
+		cfg.SMTPPort = 587
+	}
+
+	return cfg, nil
+}
+
+// RunIMAP connects to the configured mailbox, and for as long as the
+// process runs, feeds unseen messages from whitelisted senders through the
+// shared Process pipeline, replying over SMTP. It polls the mailbox on
+// PollInterval; servers that support IDLE would let this block on the
+// server instead, but a plain poll loop needs no extra protocol support
+// and is good enough for a self-hosted mailbox.
+func RunIMAP(cfg Config, imapCfg IMAPConfig) error {
+	s, err := session.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create aws session: %v", err)
+	}
+
+	c, err := dialIMAP(imapCfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to imap server: %v", err)
+	}
+	defer c.Logout()
+
+	replier := SMTPReplier{imapCfg}
+
+	for {
+		if err := pollIMAP(cfg, s, c, imapCfg, replier); err != nil {
+			log.Printf("imap poll failed: %v", err)
+		}
+		time.Sleep(imapCfg.PollInterval)
+	}
+}
+
+func dialIMAP(cfg IMAPConfig) (*client.Client, error) {
+	var c *client.Client
+	var err error
+
+	if cfg.TLS {
+		c, err = client.DialTLS(cfg.Server, nil)
+	} else {
+		c, err = client.Dial(cfg.Server)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Login(cfg.Username, cfg.Password); err != nil {
+		return nil, fmt.Errorf("failed to login: %v", err)
+	}
+
+	return c, nil
+}
+
+func pollIMAP(cfg Config, s *session.Session, c *client.Client, imapCfg IMAPConfig, replier Replier) error {
+	if _, err := c.Select(imapCfg.Mailbox, false); err != nil {
+		return fmt.Errorf("failed to select mailbox: %v", err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+
+	uids, err := c.Search(criteria)
+	if err != nil {
+		return fmt.Errorf("failed to search mailbox: %v", err)
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	section := &imap.BodySectionName{}
+	messages := make(chan *imap.Message, len(uids))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqset, []imap.FetchItem{section.FetchItem(), imap.FetchEnvelope}, messages)
+	}()
+
+	seen := new(imap.SeqSet)
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+
+		from := ""
+		if len(msg.Envelope.From) > 0 {
+			from = msg.Envelope.From[0].Address()
+		}
+
+		in := IncomingMail{
+			From: from,
+			To:   []string{imapCfg.Username},
+			Raw:  body,
+			ID:   fmt.Sprintf("%s-%d", imapCfg.Mailbox, msg.SeqNum),
+		}
+
+		if err := Process(cfg, s, in, replier); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		seen.AddNum(msg.SeqNum)
+	}
+
+	if err := <-done; err != nil {
+		return err
+	}
+
+	// Marked \Seen only after the fetch that's still in flight above
+	// finishes: go-imap's Client doesn't support issuing a command (this
+	// Store) while another (the Fetch) is outstanding on the same
+	// connection.
+	if !seen.Empty() {
+		if err := c.Store(seen, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil); err != nil {
+			return fmt.Errorf("failed to mark messages seen: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// SMTPReplier sends replies through the same account the imap source reads
+// from, so users only need to hand unmht one set of mailbox credentials.
+type SMTPReplier struct {
+	cfg IMAPConfig
+}
+
+func (r SMTPReplier) Reply(rep string) error {
+	to, err := replyRecipient(rep)
+	if err != nil {
+		return err
+	}
+
+	host := r.cfg.SMTPServer
+	auth := smtp.PlainAuth("", r.cfg.Username, r.cfg.Password, host)
+	addr := fmt.Sprintf("%s:%d", host, r.cfg.SMTPPort)
+
+	if !r.cfg.SMTPTLS {
+		return smtp.SendMail(addr, auth, r.cfg.Username, []string{to}, []byte(rep))
+	}
+
+	return sendMailTLS(addr, auth, r.cfg.Username, to, []byte(rep), host)
+}
+
+// replyRecipient pulls the To address back out of a rendered reply, since
+// smtp.SendMail needs an explicit envelope recipient rather than deriving
+// one from the message headers the way SES does.
+func replyRecipient(rep string) (string, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(rep))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse rendered reply: %v", err)
+	}
+
+	addr, err := mail.ParseAddress(msg.Header.Get("To"))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse reply recipient: %v", err)
+	}
+
+	return addr.Address, nil
+}
+
+// sendMailTLS is smtp.SendMail with an explicit tls.Config, since
+// smtp.SendMail's StartTLS negotiation doesn't let us name the server.
+func sendMailTLS(addr string, auth smtp.Auth, from string, to string, msg []byte, host string) error {
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+		return err
+	}
+
+	if err := c.Auth(auth); err != nil {
+		return err
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
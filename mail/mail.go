@@ -0,0 +1,218 @@
+// Package mail extracts the embedded .mht and PNG from an incoming
+// timetable email and renders the reply that gets sent back.
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"text/template"
+
+	"github.com/fmovlex/unmht-aws/vision"
+)
+
+// ExtractMHT finds the base64-encoded .mht attachment in a multipart/mixed
+// message.
+func ExtractMHT(msg *mail.Message) (io.Reader, error) {
+	mt, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse media type: %v", err)
+	}
+	if mt != "multipart/mixed" {
+		return nil, fmt.Errorf("expected multipart/mixed, but got %s", mt)
+	}
+
+	boundary := params["boundary"]
+	reader := multipart.NewReader(msg.Body, boundary)
+
+	var found io.Reader
+	part, err := reader.NextPart()
+	for i := 0; err == nil && i < 20; i++ {
+		cd := part.Header.Get("Content-Disposition")
+		ct := part.Header.Get("Content-Type")
+		cte := part.Header.Get("Content-Transfer-Encoding")
+
+		if strings.Contains(cd, ".mht") && strings.HasPrefix(ct, "application/octet-stream") && cte == "base64" {
+			found = part
+			break
+		}
+		part, err = reader.NextPart()
+	}
+
+	if found == nil {
+		return nil, errors.New("couldn't find an attachment - not a timetable")
+	}
+
+	return found, nil
+}
+
+// ExtractPNG finds the base64-encoded inline PNG in a multipart/related
+// message (i.e. the message embedded in the .mht ExtractMHT returns).
+func ExtractPNG(msg *mail.Message) (io.Reader, error) {
+	mt, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse media type: %v", err)
+	}
+	if mt != "multipart/related" {
+		return nil, fmt.Errorf("expected multipart/related, but got %s", mt)
+	}
+
+	boundary := params["boundary"]
+	reader := multipart.NewReader(msg.Body, boundary)
+
+	var found io.Reader
+	part, err := reader.NextPart()
+	for i := 0; err == nil && i < 20; i++ {
+		ct := part.Header.Get("Content-Type")
+		cte := part.Header.Get("Content-Transfer-Encoding")
+		if ct == "image/png" && cte == "base64" {
+			found = part
+			break
+		}
+		part, err = reader.NextPart()
+	}
+
+	if found == nil {
+		return nil, errors.New("couldn't find an encoded png - not a timetable")
+	}
+
+	return found, nil
+}
+
+type ReplyData struct {
+	From      string
+	To        string
+	Subject   string
+	InReplyTo string
+	Analytics string
+	PNGStr    string
+	// Entries and Fixes render the HTML alternative's table and <pre>
+	// block; a plaintext-only reply (e.g. no entries parsed) just leaves
+	// them empty.
+	Entries []ReplyEntry
+	Fixes   []string
+}
+
+// ReplyEntry is the display-formatted mirror of a vision.Entry that
+// replyTmpl's HTML table ranges over, built by FormatEntries.
+type ReplyEntry struct {
+	Date     string
+	Activity string
+	In       string
+	Out      string
+	// Problem marks rows domagic flagged, so the HTML table can highlight
+	// them the same way the plaintext analytics lists them.
+	Problem bool
+}
+
+// FormatEntries renders parsed entries' dates/times down to the strings
+// replyTmpl's HTML table displays, flagging rows with a non-empty
+// activity the same way vision's domagic treats them as a problem day.
+func FormatEntries(entries []vision.Entry) []ReplyEntry {
+	out := make([]ReplyEntry, len(entries))
+	for i, e := range entries {
+		out[i] = ReplyEntry{
+			Date:     e.Date().Format("02/01"),
+			Activity: e.Activity(),
+			Problem:  e.Activity() != "",
+		}
+		if in := e.In(); in != nil {
+			out[i].In = in.Format("15:04")
+		}
+		if o := e.Out(); o != nil {
+			out[i].Out = o.Format("15:04")
+		}
+	}
+	return out
+}
+
+// RenderReply renders the raw multipart/mixed reply - a multipart/related
+// wrapping the multipart/alternative (plaintext analytics + an HTML table of
+// entries) and the PNG the HTML references via cid:, plus the same PNG again
+// as a plain attachment for downloading - ready to hand to a transport's
+// send step.
+func RenderReply(data ReplyData) (string, error) {
+	var b bytes.Buffer
+	if err := replyTmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+var replyTmpl = template.Must(template.New("reply").Parse(`Content-Type: multipart/mixed; boundary="bo_un_da_ry"
+MIME-Version: 1.0
+From: {{.From}}
+To: {{.To}}
+Subject: RE: {{.Subject}}
+References: {{.InReplyTo}}
+In-Reply-To: {{.InReplyTo}}
+
+--bo_un_da_ry
+Content-Type: multipart/related; boundary="bo_un_da_ry_rel"
+MIME-Version: 1.0
+
+--bo_un_da_ry_rel
+Content-Type: multipart/alternative; boundary="bo_un_da_ry_alt"
+MIME-Version: 1.0
+
+--bo_un_da_ry_alt
+Content-Type: text/plain; charset="UTF-8"
+MIME-Version: 1.0
+Content-Transfer-Encoding: 7bit
+
+Here's a fresh unmht for you buddy.
+{{.Analytics}}
+
+--bo_un_da_ry_alt
+Content-Type: text/html; charset="UTF-8"
+MIME-Version: 1.0
+Content-Transfer-Encoding: 7bit
+
+<html><body>
+<p>Here's a fresh unmht for you buddy.</p>
+{{- if .Entries}}
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Date</th><th>Activity</th><th>In</th><th>Out</th></tr>
+{{- range .Entries}}
+<tr{{if .Problem}} style="background-color:#fdd"{{end}}><td>{{.Date}}</td><td>{{.Activity}}</td><td>{{.In}}</td><td>{{.Out}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Fixes}}
+<p>Here's a quick reply for your partial days:</p>
+<pre>
+{{- range .Fixes}}
+{{.}}
+{{- end}}
+</pre>
+{{- end}}
+<p><img src="cid:timetable-png" alt="times.png"></p>
+</body></html>
+
+--bo_un_da_ry_alt--
+
+--bo_un_da_ry_rel
+Content-Type: image/png
+MIME-Version: 1.0
+Content-Transfer-Encoding: base64
+Content-ID: <timetable-png>
+Content-Disposition: inline; filename="times.png"
+
+{{.PNGStr}}
+
+--bo_un_da_ry_rel--
+
+--bo_un_da_ry
+Content-Type: image/png
+MIME-Version: 1.0
+Content-Transfer-Encoding: base64
+Content-Disposition: attachment; filename="times.png"
+
+{{.PNGStr}}
+
+--bo_un_da_ry--`))
@@ -0,0 +1,39 @@
+package unmht
+
+import (
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/ses"
+)
+
+// GetMail fetches the raw message SES stashed in S3 for the given message
+// ID, the S3 source used by cmd/lambda.
+func GetMail(s *session.Session, bucket string, msgID string) (io.ReadCloser, error) {
+	s3c := s3.New(s)
+	obj, err := s3c.GetObject(&s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &msgID,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.Body, nil
+}
+
+// SESReplier sends the reply as a raw email through SES, the matching
+// transport for the S3-sourced Lambda path.
+type SESReplier struct {
+	Session *session.Session
+}
+
+func (r SESReplier) Reply(rep string) error {
+	sesc := ses.New(r.Session)
+	_, err := sesc.SendRawEmail(&ses.SendRawEmailInput{
+		RawMessage: &ses.RawMessage{Data: []byte(rep)},
+	})
+	return err
+}
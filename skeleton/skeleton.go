@@ -1,4 +1,8 @@
-package main
+// Package skeleton reduces a timetable PNG to a grid of pixel-aligned rows
+// and columns by walking the gridlines directly, without any OCR. It backs
+// the Rekognition OCR path in package vision; Textract doesn't need it
+// since AnalyzeDocument already returns its own row/column coordinates.
+package skeleton
 
 import (
 	"bytes"
@@ -25,6 +29,26 @@ type Skeleton struct {
 	Cols Cols
 }
 
+// Grid maps a point in a primed image to the (row, col) timetable cell it
+// falls in. Skeleton is the pixel-based implementation derived from Prime.
+type Grid interface {
+	Cell(x, y int) (row int, col int, err error)
+}
+
+func (sk Skeleton) Cell(x, y int) (int, int, error) {
+	r, err := sk.Rows.Find(y)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	c, err := sk.Cols.Find(x)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return r, c, nil
+}
+
 type Rows []*Row
 
 type Row struct {
@@ -88,7 +112,7 @@ func (c *Col) Split() Cols {
 	return Cols{c1, c2}
 }
 
-func prime(img *image.NRGBA) (*Primed, error) {
+func Prime(img *image.NRGBA) (*Primed, error) {
 	row0, err := findRow0(img)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	"github.com/fmovlex/unmht-aws/vision"
+)
+
+const weekStartFormat = "2006-01-02"
+
+// DynamoStore keys each item on (UserEmail, WeekStart) and keeps that
+// week's entries JSON-encoded in a single attribute rather than one item
+// per entry, since a week is always read and written as a unit.
+type DynamoStore struct {
+	Client *dynamodb.DynamoDB
+	Table  string
+}
+
+func NewDynamoStore(s *session.Session, table string) *DynamoStore {
+	return &DynamoStore{Client: dynamodb.New(s), Table: table}
+}
+
+func (d *DynamoStore) PutWeek(userEmail string, weekStart time.Time, entries []vision.Entry) error {
+	dtos := make([]entryDTO, len(entries))
+	for i, e := range entries {
+		dtos[i] = toDTO(e)
+	}
+
+	blob, err := json.Marshal(dtos)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entries: %v", err)
+	}
+
+	_, err = d.Client.PutItem(&dynamodb.PutItemInput{
+		TableName: &d.Table,
+		Item: map[string]*dynamodb.AttributeValue{
+			"UserEmail": {S: aws.String(userEmail)},
+			"WeekStart": {S: aws.String(weekStart.Format(weekStartFormat))},
+			"Entries":   {S: aws.String(string(blob))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put week: %v", err)
+	}
+
+	return nil
+}
+
+func (d *DynamoStore) Query(userEmail string, from, to time.Time) ([]vision.Entry, error) {
+	keyCond := expression.Key("UserEmail").Equal(expression.Value(userEmail)).
+		And(expression.Key("WeekStart").Between(
+			expression.Value(from.Format(weekStartFormat)),
+			expression.Value(to.Format(weekStartFormat)),
+		))
+
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %v", err)
+	}
+
+	out, err := d.Client.Query(&dynamodb.QueryInput{
+		TableName:                 &d.Table,
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query weeks: %v", err)
+	}
+
+	var entries []vision.Entry
+	for _, item := range out.Items {
+		var dtos []entryDTO
+		if err := json.Unmarshal([]byte(*item["Entries"].S), &dtos); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal entries: %v", err)
+		}
+
+		for _, dto := range dtos {
+			if dto.Date.Before(from) || dto.Date.After(to) {
+				continue
+			}
+			entries = append(entries, fromDTO(dto))
+		}
+	}
+
+	return entries, nil
+}
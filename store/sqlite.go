@@ -0,0 +1,130 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/fmovlex/unmht-aws/vision"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS entries (
+	user_email TEXT NOT NULL,
+	week_start TEXT NOT NULL,
+	date       TEXT NOT NULL,
+	activity   TEXT NOT NULL,
+	in_time    TEXT,
+	out_time   TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_entries_user_date ON entries(user_email, date);
+`
+
+// SQLiteStore is the self-hosted alternative to DynamoStore, for users
+// running unmht outside of AWS (e.g. behind the imap source).
+type SQLiteStore struct {
+	DB *sql.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite db: %v", err)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate sqlite db: %v", err)
+	}
+
+	return &SQLiteStore{DB: db}, nil
+}
+
+func (s *SQLiteStore) PutWeek(userEmail string, weekStart time.Time, entries []vision.Entry) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	weekKey := weekStart.Format(weekStartFormat)
+
+	if _, err := tx.Exec(`DELETE FROM entries WHERE user_email = ? AND week_start = ?`, userEmail, weekKey); err != nil {
+		return fmt.Errorf("failed to clear existing week: %v", err)
+	}
+
+	for _, e := range entries {
+		dto := toDTO(e)
+
+		var inStr, outStr *string
+		if dto.In != nil {
+			s := dto.In.Format(time.RFC3339)
+			inStr = &s
+		}
+		if dto.Out != nil {
+			s := dto.Out.Format(time.RFC3339)
+			outStr = &s
+		}
+
+		_, err := tx.Exec(
+			`INSERT INTO entries (user_email, week_start, date, activity, in_time, out_time) VALUES (?, ?, ?, ?, ?, ?)`,
+			userEmail, weekKey, dto.Date.Format(time.RFC3339), dto.Activity, inStr, outStr,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert entry: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Query(userEmail string, from, to time.Time) ([]vision.Entry, error) {
+	rows, err := s.DB.Query(
+		`SELECT date, activity, in_time, out_time FROM entries WHERE user_email = ? AND date >= ? AND date <= ? ORDER BY date`,
+		userEmail, from.Format(time.RFC3339), to.Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query entries: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []vision.Entry
+	for rows.Next() {
+		var dateStr, activity string
+		var inStr, outStr *string
+		if err := rows.Scan(&dateStr, &activity, &inStr, &outStr); err != nil {
+			return nil, fmt.Errorf("failed to scan entry: %v", err)
+		}
+
+		date, err := time.Parse(time.RFC3339, dateStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse date: %v", err)
+		}
+
+		in, err := parseOptionalTime(inStr)
+		if err != nil {
+			return nil, err
+		}
+		out, err := parseOptionalTime(outStr)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, vision.NewEntry(date, activity, in, out))
+	}
+
+	return entries, rows.Err()
+}
+
+func parseOptionalTime(s *string) (*time.Time, error) {
+	if s == nil {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, *s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse time: %v", err)
+	}
+	return &t, nil
+}
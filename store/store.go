@@ -0,0 +1,36 @@
+// Package store persists parsed weekly timetables so vision.ComputeTrends
+// can compare a user's current week against their own history instead of
+// just the current week's average.
+package store
+
+import (
+	"time"
+
+	"github.com/fmovlex/unmht-aws/vision"
+)
+
+// Store is implemented by DynamoStore and SQLiteStore.
+type Store interface {
+	// PutWeek replaces whatever is stored for userEmail/weekStart with
+	// entries.
+	PutWeek(userEmail string, weekStart time.Time, entries []vision.Entry) error
+	// Query returns every entry for userEmail with a date in [from, to].
+	Query(userEmail string, from, to time.Time) ([]vision.Entry, error)
+}
+
+// entryDTO is the serializable mirror of vision.Entry, whose own fields are
+// unexported.
+type entryDTO struct {
+	Date     time.Time  `json:"date"`
+	Activity string     `json:"activity"`
+	In       *time.Time `json:"in,omitempty"`
+	Out      *time.Time `json:"out,omitempty"`
+}
+
+func toDTO(e vision.Entry) entryDTO {
+	return entryDTO{Date: e.Date(), Activity: e.Activity(), In: e.In(), Out: e.Out()}
+}
+
+func fromDTO(d entryDTO) vision.Entry {
+	return vision.NewEntry(d.Date, d.Activity, d.In, d.Out)
+}
@@ -1,30 +0,0 @@
-// Code generated by private/model/cli/gen-api/main.go. DO NOT EDIT.
-
-package autoscalingplans
-
-const (
-
-	// ErrCodeConcurrentUpdateException for service response error code
-	// "ConcurrentUpdateException".
-	ErrCodeConcurrentUpdateException = "ConcurrentUpdateException"
-
-	// ErrCodeInternalServiceException for service response error code
-	// "InternalServiceException".
-	ErrCodeInternalServiceException = "InternalServiceException"
-
-	// ErrCodeInvalidNextTokenException for service response error code
-	// "InvalidNextTokenException".
-	ErrCodeInvalidNextTokenException = "InvalidNextTokenException"
-
-	// ErrCodeLimitExceededException for service response error code
-	// "LimitExceededException".
-	ErrCodeLimitExceededException = "LimitExceededException"
-
-	// ErrCodeObjectNotFoundException for service response error code
-	// "ObjectNotFoundException".
-	ErrCodeObjectNotFoundException = "ObjectNotFoundException"
-
-	// ErrCodeValidationException for service response error code
-	// "ValidationException".
-	ErrCodeValidationException = "ValidationException"
-)
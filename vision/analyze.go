@@ -1,16 +1,20 @@
-package main
+// Package vision turns a timetable PNG into parsed entries and the
+// analytics text that goes back to the user. Two OCR backends produce the
+// same []Entry shape: RekognitionBackend (skeleton.Grid + DetectText) and
+// TextractBackend (AnalyzeDocument table extraction).
+package vision
 
 import (
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"image"
-	"image/png"
 	"io"
+	"io/ioutil"
 	"log"
-	"sort"
+	"os"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -21,42 +25,67 @@ import (
 type Magic struct {
 	Problems []string
 	Fixes    []string
+	// Trends is filled in by the caller (via ComputeTrends) once history
+	// is available; Analyze alone has no notion of past weeks.
+	Trends *TrendsReport
 }
 
-func analyze(s *session.Session, msgID string, pngr io.Reader) (*Magic, error) {
-	img, err := png.Decode(pngr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode png: %v", err)
-	}
-
-	nimg, ok := img.(*image.NRGBA)
-	if !ok {
-		return nil, fmt.Errorf("failed to cast NRGBA: %v", img)
-	}
+// Backend turns a decoded timetable PNG into parsed entries. Analyze picks
+// one via UNMHT_OCR so every backend produces the same []Entry shape for
+// domagic.
+type Backend interface {
+	Extract(s *session.Session, msgID string, png []byte) ([]Entry, error)
+}
 
-	primed, err := prime(nimg)
+// Analyze runs the configured OCR backend over a timetable PNG and
+// computes the user-facing analytics. It also returns the parsed entries so
+// callers can persist them for cross-week trends (see ComputeTrends).
+func Analyze(s *session.Session, bucket string, msgID string, pngr io.Reader) (*Magic, []Entry, error) {
+	pngb, err := ioutil.ReadAll(pngr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to prime image: %v", err)
+		return nil, nil, fmt.Errorf("failed to read png: %v", err)
 	}
 
-	rc := rekognition.New(s)
-	out, err := rc.DetectText(&rekognition.DetectTextInput{
-		Image: &rekognition.Image{Bytes: primed.Data},
-	})
+	entries, err := backend(bucket).Extract(s, msgID, pngb)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call rekognition api: %v", err)
+		return nil, nil, err
 	}
 
-	entries, err := scan(out, primed.Skeleton)
-	if err != nil {
-		uploadDebug(s, msgID, primed.Data, out)
-		return nil, fmt.Errorf("failed to parse entries: %v. debug logs: %s", err, msgID)
+	return domagic(entries), entries, nil
+}
+
+// WeekStart returns the Monday preceding the earliest entry, the key under
+// which a parsed week is persisted. Entries whose DateHeader never parsed
+// carry a zero-value date and are skipped, so one bad row can't file the
+// whole week under year 0001.
+func WeekStart(entries []Entry) time.Time {
+	var min time.Time
+	for _, e := range entries {
+		if e.date.IsZero() {
+			continue
+		}
+		if min.IsZero() || e.date.Before(min) {
+			min = e.date
+		}
+	}
+	if min.IsZero() {
+		return time.Time{}
 	}
 
-	return domagic(entries), nil
+	offset := (int(min.Weekday()) + 6) % 7 // days since Monday
+	return min.AddDate(0, 0, -offset)
 }
 
-func uploadDebug(s *session.Session, msgID string, img []byte, rekout *rekognition.DetectTextOutput) {
+func backend(bucket string) Backend {
+	switch os.Getenv("UNMHT_OCR") {
+	case "textract":
+		return TextractBackend{fallback: RekognitionBackend{Bucket: bucket}}
+	default:
+		return RekognitionBackend{Bucket: bucket}
+	}
+}
+
+func uploadDebug(s *session.Session, bucket string, msgID string, img []byte, rekout *rekognition.DetectTextOutput) {
 	s3c := s3manager.NewUploader(s)
 
 	imgKey := fmt.Sprintf("%s-debug-img", msgID)
@@ -93,69 +122,6 @@ const (
 	OutHeader
 )
 
-func center(box *rekognition.BoundingBox, sk Skeleton) image.Point {
-	w, h := float64(sk.W), float64(sk.H)
-	xmid := *box.Left*w + *box.Width*w/2
-	ymid := *box.Top*h + *box.Height*h/2
-	return image.Point{X: int(xmid), Y: int(ymid)}
-}
-
-func scan(out *rekognition.DetectTextOutput, sk Skeleton) ([]Entry, error) {
-	var entries = make([]Entry, len(sk.Rows))
-
-	dts := append([]*rekognition.TextDetection{}, out.TextDetections...)
-	sort.Slice(dts, func(i, j int) bool {
-		return *dts[i].Geometry.BoundingBox.Left < *dts[j].Geometry.BoundingBox.Left
-	})
-
-	for _, d := range dts {
-		if d.Type == nil || *d.Type != "WORD" {
-			continue
-		}
-
-		box := d.Geometry.BoundingBox
-		center := center(box, sk)
-
-		c, err := sk.Cols.Find(center.X)
-		if err != nil {
-			continue
-		}
-
-		r, err := sk.Rows.Find(center.Y)
-		if err != nil {
-			continue
-		}
-
-		txt := *d.DetectedText
-		e := &entries[r]
-
-		switch header(c) {
-		case DateHeader:
-			date, err := parseDate(txt)
-			if err != nil {
-				return nil, err
-			}
-			e.date = date
-		case ActivityHeader:
-			e.activity += txt
-		case InHeader:
-			t, err := parseTime(e.date.Format(dateFormat), txt)
-			if err != nil {
-				return nil, err
-			}
-			e.in = t
-		case OutHeader:
-			t, err := parseTime(e.date.Format(dateFormat), txt)
-			if err != nil {
-				return nil, err
-			}
-			e.out = t
-		}
-	}
-
-	return entries, nil
-}
-
 func parseDate(s string) (time.Time, error) {
 	var date time.Time
 	var clean string
@@ -210,6 +176,24 @@ type Entry struct {
 	out      *time.Time
 }
 
+// NewEntry builds an Entry from already-parsed fields, for callers (like
+// package store) that reconstruct entries from persisted history rather
+// than OCR output.
+func NewEntry(date time.Time, activity string, in, out *time.Time) Entry {
+	return Entry{date: date, activity: activity, in: in, out: out}
+}
+
+func (e Entry) Date() time.Time  { return e.date }
+func (e Entry) Activity() string { return e.activity }
+func (e Entry) In() *time.Time   { return e.in }
+func (e Entry) Out() *time.Time  { return e.out }
+
+// timeOfDay reduces a time.Time to its offset since midnight, which is all
+// average/stddev/trend comparisons care about.
+func timeOfDay(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
 func average(entries []Entry, extractor func(Entry) *time.Time, def time.Duration) time.Duration {
 	var total time.Duration
 	var count int64 = 0
@@ -219,9 +203,8 @@ func average(entries []Entry, extractor func(Entry) *time.Time, def time.Duratio
 			continue
 		}
 
-		d := time.Duration(v.Hour())*time.Hour + time.Duration(v.Minute())*time.Minute
 		count++
-		total += d
+		total += timeOfDay(*v)
 	}
 
 	if count == 0 {
@@ -304,3 +287,50 @@ func fixEntry(e Entry, avgIn time.Duration, avgOut time.Duration) (string, error
 	txt := fmt.Sprintf("%s: arrived at %s, left at %s", pdate, pin, pout)
 	return txt, nil
 }
+
+// RenderAnalytics turns a Magic into the user-facing analytics text that
+// goes in the reply body.
+func RenderAnalytics(magic *Magic) (string, error) {
+	const nothing = "no analytics available."
+
+	var b bytes.Buffer
+	if err := analyticsTmpl.Execute(&b, magic); err != nil {
+		return nothing, err
+	}
+
+	return b.String(), nil
+}
+
+var analyticsTmpl = template.Must(template.New("analytics").Parse(`
+{{- if .Problems }}
+Looks like there's a few non-standard days:
+{{- range .Problems }}
+  - {{.}}
+{{- end }}
+{{ if .Fixes }}
+Here's a quick reply for your partial days:
+
+---------------
+
+Hey,
+{{ range .Fixes }}
+{{.}}
+{{- end }}
+
+Thanks
+
+---------------
+
+{{ end }}
+{{ else }}
+Everything looks good.
+{{ end }}
+{{- if .Trends }}
+
+Trends:
+  Usual arrival: {{.Trends.BaselineIn}} (this week {{.Trends.WeekIn}}, {{.Trends.DeltaIn}})
+  Usual departure: {{.Trends.BaselineOut}} (this week {{.Trends.WeekOut}}, {{.Trends.DeltaOut}})
+{{- range .Trends.Flagged }}
+  - {{.}}
+{{- end }}
+{{- end }}`))
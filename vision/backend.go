@@ -0,0 +1,112 @@
+package vision
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/rekognition"
+
+	"github.com/fmovlex/unmht-aws/skeleton"
+)
+
+// RekognitionBackend is the original pipeline: skeleton.Prime reduces the
+// image to a pixel grid of rows/cols, Rekognition's DetectText reads the
+// text, and scan maps each word back onto the grid.
+type RekognitionBackend struct {
+	Bucket string
+}
+
+func (b RekognitionBackend) Extract(s *session.Session, msgID string, pngb []byte) ([]Entry, error) {
+	img, err := png.Decode(bytes.NewReader(pngb))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode png: %v", err)
+	}
+
+	nimg, ok := img.(*image.NRGBA)
+	if !ok {
+		return nil, fmt.Errorf("failed to cast NRGBA: %v", img)
+	}
+
+	primed, err := skeleton.Prime(nimg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prime image: %v", err)
+	}
+
+	rc := rekognition.New(s)
+	out, err := rc.DetectText(&rekognition.DetectTextInput{
+		Image: &rekognition.Image{Bytes: primed.Data},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call rekognition api: %v", err)
+	}
+
+	entries, err := scan(out, primed.Skeleton)
+	if err != nil {
+		uploadDebug(s, b.Bucket, msgID, primed.Data, out)
+		return nil, fmt.Errorf("failed to parse entries: %v. debug logs: %s", err, msgID)
+	}
+
+	return entries, nil
+}
+
+func center(box *rekognition.BoundingBox, sk skeleton.Skeleton) image.Point {
+	w, h := float64(sk.W), float64(sk.H)
+	xmid := *box.Left*w + *box.Width*w/2
+	ymid := *box.Top*h + *box.Height*h/2
+	return image.Point{X: int(xmid), Y: int(ymid)}
+}
+
+func scan(out *rekognition.DetectTextOutput, sk skeleton.Skeleton) ([]Entry, error) {
+	var entries = make([]Entry, len(sk.Rows))
+
+	dts := append([]*rekognition.TextDetection{}, out.TextDetections...)
+	sort.Slice(dts, func(i, j int) bool {
+		return *dts[i].Geometry.BoundingBox.Left < *dts[j].Geometry.BoundingBox.Left
+	})
+
+	for _, d := range dts {
+		if d.Type == nil || *d.Type != "WORD" {
+			continue
+		}
+
+		box := d.Geometry.BoundingBox
+		center := center(box, sk)
+
+		r, c, err := sk.Cell(center.X, center.Y)
+		if err != nil {
+			continue
+		}
+
+		txt := *d.DetectedText
+		e := &entries[r]
+
+		switch header(c) {
+		case DateHeader:
+			date, err := parseDate(txt)
+			if err != nil {
+				return nil, err
+			}
+			e.date = date
+		case ActivityHeader:
+			e.activity += txt
+		case InHeader:
+			t, err := parseTime(e.date.Format(dateFormat), txt)
+			if err != nil {
+				return nil, err
+			}
+			e.in = t
+		case OutHeader:
+			t, err := parseTime(e.date.Format(dateFormat), txt)
+			if err != nil {
+				return nil, err
+			}
+			e.out = t
+		}
+	}
+
+	return entries, nil
+}
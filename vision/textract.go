@@ -0,0 +1,118 @@
+package vision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/textract"
+)
+
+// TextractBackend calls Textract's table analysis and assembles []Entry
+// directly from the returned Block graph (TABLE -> CELL -> WORD), using
+// each cell's RowIndex/ColumnIndex instead of reconstructing a grid from
+// pixels. Row 1 is Textract's header row, so data starts at RowIndex 2;
+// there is no leading label column, so ColumnIndex 1 is the same
+// DateHeader/ActivityHeader/InHeader/OutHeader column order as the
+// Rekognition path once shifted from Textract's 1-based indices.
+type TextractBackend struct {
+	// fallback is used if Textract doesn't find any tables at all, e.g.
+	// because the timetable image doesn't render with visible gridlines.
+	fallback Backend
+}
+
+func (b TextractBackend) Extract(s *session.Session, msgID string, pngb []byte) ([]Entry, error) {
+	tc := textract.New(s)
+	out, err := tc.AnalyzeDocument(&textract.AnalyzeDocumentInput{
+		Document:     &textract.Document{Bytes: pngb},
+		FeatureTypes: []*string{aws.String("TABLES")},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call textract api: %v", err)
+	}
+
+	entries, err := entriesFromBlocks(out.Blocks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse textract blocks: %v", err)
+	}
+
+	if len(entries) == 0 && b.fallback != nil {
+		return b.fallback.Extract(s, msgID, pngb)
+	}
+
+	return entries, nil
+}
+
+func entriesFromBlocks(blocks []*textract.Block) ([]Entry, error) {
+	byID := make(map[string]*textract.Block, len(blocks))
+	for _, blk := range blocks {
+		byID[*blk.Id] = blk
+	}
+
+	var maxRow int64
+	for _, blk := range blocks {
+		if *blk.BlockType == "CELL" && *blk.RowIndex > maxRow {
+			maxRow = *blk.RowIndex
+		}
+	}
+	if maxRow < 2 {
+		return nil, nil
+	}
+
+	entries := make([]Entry, maxRow-1)
+
+	for _, blk := range blocks {
+		if *blk.BlockType != "CELL" || *blk.RowIndex < 2 {
+			continue
+		}
+
+		txt := strings.TrimSpace(cellText(blk, byID))
+		if txt == "" {
+			continue
+		}
+
+		e := &entries[*blk.RowIndex-2]
+		switch header(*blk.ColumnIndex - 1) {
+		case DateHeader:
+			date, err := parseDate(txt)
+			if err != nil {
+				return nil, err
+			}
+			e.date = date
+		case ActivityHeader:
+			e.activity += txt
+		case InHeader:
+			t, err := parseTime(e.date.Format(dateFormat), txt)
+			if err != nil {
+				return nil, err
+			}
+			e.in = t
+		case OutHeader:
+			t, err := parseTime(e.date.Format(dateFormat), txt)
+			if err != nil {
+				return nil, err
+			}
+			e.out = t
+		}
+	}
+
+	return entries, nil
+}
+
+func cellText(cell *textract.Block, byID map[string]*textract.Block) string {
+	var words []string
+	for _, rel := range cell.Relationships {
+		if *rel.Type != "CHILD" {
+			continue
+		}
+		for _, id := range rel.Ids {
+			child, ok := byID[*id]
+			if !ok || *child.BlockType != "WORD" {
+				continue
+			}
+			words = append(words, *child.Text)
+		}
+	}
+	return strings.Join(words, "")
+}
@@ -0,0 +1,103 @@
+package vision
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// TrendsReport compares the current week against a user's own history:
+// their baseline in/out times, this week's delta from that baseline, and
+// any days that deviate more than stddevThreshold standard deviations from
+// it.
+type TrendsReport struct {
+	BaselineIn  string
+	BaselineOut string
+	WeekIn      string
+	WeekOut     string
+	DeltaIn     string
+	DeltaOut    string
+	Flagged     []string
+}
+
+// ComputeTrends folds history (entries from prior weeks) and the current
+// week's entries into a TrendsReport. It returns nil if there isn't enough
+// history to establish a baseline.
+func ComputeTrends(current []Entry, history []Entry, stddevThreshold float64) *TrendsReport {
+	if len(history) == 0 {
+		return nil
+	}
+
+	baselineIn := averageIn(history)
+	baselineOut := averageOut(history)
+	weekIn := averageIn(current)
+	weekOut := averageOut(current)
+
+	stddevIn := stddevOf(history, func(e Entry) *time.Time { return e.in }, baselineIn)
+	stddevOut := stddevOf(history, func(e Entry) *time.Time { return e.out }, baselineOut)
+
+	report := &TrendsReport{
+		BaselineIn:  fmtTimeOfDay(baselineIn),
+		BaselineOut: fmtTimeOfDay(baselineOut),
+		WeekIn:      fmtTimeOfDay(weekIn),
+		WeekOut:     fmtTimeOfDay(weekOut),
+		DeltaIn:     fmtDelta(weekIn - baselineIn),
+		DeltaOut:    fmtDelta(weekOut - baselineOut),
+	}
+
+	for _, e := range current {
+		if dev := deviation(e.in, baselineIn, stddevIn); dev > stddevThreshold {
+			report.Flagged = append(report.Flagged, fmt.Sprintf(
+				"%s: arrived %s, %.1f stddev from your usual %s",
+				e.date.Format(prettyDate), e.in.Format(prettyTime), dev, fmtTimeOfDay(baselineIn)))
+		}
+		if dev := deviation(e.out, baselineOut, stddevOut); dev > stddevThreshold {
+			report.Flagged = append(report.Flagged, fmt.Sprintf(
+				"%s: left %s, %.1f stddev from your usual %s",
+				e.date.Format(prettyDate), e.out.Format(prettyTime), dev, fmtTimeOfDay(baselineOut)))
+		}
+	}
+
+	return report
+}
+
+func deviation(t *time.Time, baseline time.Duration, stddev time.Duration) float64 {
+	if t == nil || stddev == 0 {
+		return 0
+	}
+	diff := math.Abs((timeOfDay(*t) - baseline).Seconds())
+	return diff / stddev.Seconds()
+}
+
+func stddevOf(entries []Entry, extractor func(Entry) *time.Time, mean time.Duration) time.Duration {
+	var sumSq float64
+	var count int
+	for _, e := range entries {
+		v := extractor(e)
+		if v == nil {
+			continue
+		}
+		diff := (timeOfDay(*v) - mean).Seconds()
+		sumSq += diff * diff
+		count++
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	return time.Duration(math.Sqrt(sumSq/float64(count))) * time.Second
+}
+
+func fmtTimeOfDay(d time.Duration) string {
+	return time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(d).Format(prettyTime)
+}
+
+func fmtDelta(d time.Duration) string {
+	sign := "+"
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	return fmt.Sprintf("%s%dm", sign, int(d.Minutes()))
+}